@@ -0,0 +1,103 @@
+// Package icmp6 opens the IPv6 ICMP socket PingCLI listens for echo
+// replies on. It replaces a fixed listen address with one chosen to
+// match the destination being pinged, since "fe80::1%en0" only happens
+// to exist on one specific machine.
+package icmp6
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/net/icmp"
+)
+
+// Listen opens an IPv6 ICMP socket suitable for pinging dest. It prefers
+// the non-privileged "udp6" network (see the ping_group_range note at
+// the top of main.go) and falls back to the privileged "ip6:ipv6-icmp"
+// raw socket, which needs root or CAP_NET_RAW, when that's unavailable.
+func Listen(dest net.IP) (*icmp.PacketConn, error) {
+	addr, err := listenAddr(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn, err := icmp.ListenPacket("udp6", addr); err == nil {
+		return conn, nil
+	} else if conn, rawErr := icmp.ListenPacket("ip6:ipv6-icmp", addr); rawErr == nil {
+		return conn, nil
+	} else {
+		return nil, fmt.Errorf("icmp6: non-privileged ping unavailable (%v) and raw socket needs root or CAP_NET_RAW (%v)", err, rawErr)
+	}
+}
+
+// listenAddr picks a local IPv6 address/zone to bind to, chosen from the
+// machine's own interfaces so it stays in the same scope (link-local vs.
+// global/ULA) as dest.
+func listenAddr(dest net.IP) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("icmp6: enumerate interfaces: %w", err)
+	}
+
+	candidates := make([]candidateIface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		var ips []net.IP
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+		candidates = append(candidates, candidateIface{name: iface.Name, addrs: ips})
+	}
+
+	addr, ok := pickAddr(candidates, dest)
+	if !ok {
+		return "", fmt.Errorf("icmp6: no up, non-loopback IPv6 interface found to reach %s", dest)
+	}
+	return addr, nil
+}
+
+// candidateIface is the subset of net.Interface's state pickAddr needs,
+// pulled out so the selection logic can be exercised without real system
+// interfaces.
+type candidateIface struct {
+	name  string
+	addrs []net.IP
+}
+
+// pickAddr chooses the IPv6 address/zone from ifaces that stays in the
+// same scope (link-local vs. global/ULA) as dest.
+func pickAddr(ifaces []candidateIface, dest net.IP) (string, bool) {
+	linkLocal := dest.IsLinkLocalUnicast()
+
+	for _, iface := range ifaces {
+		for _, ip := range iface.addrs {
+			if ip.To4() != nil {
+				continue // Not IPv6.
+			}
+
+			if ip.IsLinkLocalUnicast() {
+				if !linkLocal {
+					continue // Destination isn't link-local; prefer a global/ULA source.
+				}
+				return "::%" + iface.name, true // Zone required to route link-local traffic.
+			}
+
+			if linkLocal {
+				continue // Destination is link-local; a global source won't route to it.
+			}
+			return ip.String(), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,60 @@
+package icmp6
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPickAddrLinkLocalDest(t *testing.T) {
+	ifaces := []candidateIface{
+		{name: "eth0", addrs: []net.IP{net.ParseIP("2001:db8::1")}},
+		{name: "eth1", addrs: []net.IP{net.ParseIP("fe80::1")}},
+	}
+
+	addr, ok := pickAddr(ifaces, net.ParseIP("fe80::2"))
+	if !ok {
+		t.Fatal("pickAddr() ok = false, want true")
+	}
+	if want := "::%eth1"; addr != want {
+		t.Errorf("pickAddr() = %q, want %q", addr, want)
+	}
+}
+
+func TestPickAddrGlobalDest(t *testing.T) {
+	ifaces := []candidateIface{
+		{name: "eth1", addrs: []net.IP{net.ParseIP("fe80::1")}},
+		{name: "eth0", addrs: []net.IP{net.ParseIP("2001:db8::1")}},
+	}
+
+	addr, ok := pickAddr(ifaces, net.ParseIP("2001:db8::2"))
+	if !ok {
+		t.Fatal("pickAddr() ok = false, want true")
+	}
+	if want := "2001:db8::1"; addr != want {
+		t.Errorf("pickAddr() = %q, want %q", addr, want)
+	}
+}
+
+func TestPickAddrSkipsIPv4(t *testing.T) {
+	ifaces := []candidateIface{
+		{name: "eth0", addrs: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}},
+	}
+
+	addr, ok := pickAddr(ifaces, net.ParseIP("2001:db8::2"))
+	if !ok {
+		t.Fatal("pickAddr() ok = false, want true")
+	}
+	if want := "2001:db8::1"; addr != want {
+		t.Errorf("pickAddr() = %q, want %q", addr, want)
+	}
+}
+
+func TestPickAddrNoMatch(t *testing.T) {
+	ifaces := []candidateIface{
+		{name: "eth0", addrs: []net.IP{net.ParseIP("fe80::1")}},
+	}
+
+	if _, ok := pickAddr(ifaces, net.ParseIP("2001:db8::2")); ok {
+		t.Error("pickAddr() ok = true, want false")
+	}
+}
@@ -6,154 +6,299 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/parkerottaway/PingCLI/colors"
-	"golang.org/x/net/icmp"
-	"golang.org/x/net/ipv4"
-	"golang.org/x/net/ipv6"
+	"github.com/parkerottaway/PingCLI/pinger"
+	"github.com/parkerottaway/PingCLI/report"
+	"github.com/parkerottaway/PingCLI/traceroute"
 )
 
-const (
-	TIMEOUT_SECS = 5
-)
+// pingStats accumulates min/max/average/stddev RTT using Welford's online
+// variance algorithm so the running totals never need the full history of
+// samples kept in memory.
+type pingStats struct {
+	count int64
+	mean  float64
+	m2    float64
+	min   time.Duration
+	max   time.Duration
+}
 
-// Main function.
-func main() {
+// Add folds one more RTT sample into the running statistics.
+func (s *pingStats) Add(rtt time.Duration) {
+	if s.count == 0 || rtt < s.min {
+		s.min = rtt
+	}
+	if s.count == 0 || rtt > s.max {
+		s.max = rtt
+	}
 
-	var conn *icmp.PacketConn
-	var msg icmp.Message
-	var success int = 0
-	var sent int = 0
-	var totalDuration time.Duration = 0
-	defer conn.Close() // Close on panic hit.
+	s.count++
+	delta := float64(rtt) - s.mean
+	s.mean += delta / float64(s.count)
+	delta2 := float64(rtt) - s.mean
+	s.m2 += delta * delta2
+}
 
-	// Verify an argument was provided, exit if one was not.
-	if len(os.Args) != 2 {
-		fmt.Fprint(os.Stderr, colors.FG_RED, "PingCLI requires at least one input argument.\n", colors.RESET)
-		os.Exit(0)
+// Avg returns the running mean RTT.
+func (s *pingStats) Avg() time.Duration {
+	return time.Duration(s.mean)
+}
+
+// Stddev returns the population standard deviation of the RTTs seen so far.
+func (s *pingStats) Stddev() time.Duration {
+	if s.count < 2 {
+		return 0
 	}
+	return time.Duration(math.Sqrt(s.m2 / float64(s.count)))
+}
 
-	// Get the IP if hostname provided.
-	ip, err := net.ResolveIPAddr("ip", os.Args[1])
+// toReportStats converts the running accumulator into the snapshot the
+// report package renders.
+func (s *pingStats) toReportStats() report.Stats {
+	return report.Stats{Min: s.min, Avg: s.Avg(), Max: s.max, Stddev: s.Stddev()}
+}
 
-	// Fail if an incorrect input provided.
+// readHosts reads one host per non-blank line from path.
+func readHosts(path string) ([]string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(0)
+		return nil, err
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			hosts = append(hosts, line)
+		}
+	}
+
+	return hosts, scanner.Err()
+}
+
+// Main function.
+func main() {
+
+	hostsFile := flag.String("hosts", "", "file containing one host per line to ping, in addition to any given as arguments")
+	count := flag.Int("c", 0, "stop after count rounds (0 = unlimited, stop on deadline or SIGINT)")
+	interval := flag.Duration("i", pinger.DefaultInterval, "interval between rounds")
+	deadline := flag.Duration("w", 0, "deadline, stop after this long (0 = unlimited)")
+	packetSize := flag.Int("s", pinger.DefaultPacketSize, "number of data bytes to send per echo request")
+	ttl := flag.Int("t", 0, "outbound TTL / hop limit (0 = system default)")
+	perPacketTimeout := flag.Duration("W", pinger.DefaultMaxRTT, "time to wait for replies to each round")
+	ipv4Only := flag.Bool("4", false, "resolve hosts as IPv4 only")
+	ipv6Only := flag.Bool("6", false, "resolve hosts as IPv6 only")
+	quiet := flag.Bool("q", false, "quiet mode, only print the final summary report (human output; -o json still writes one object per reply)")
+	tracerouteMode := flag.Bool("T", false, "traceroute mode: trace the route to each host instead of pinging it")
+	maxHops := flag.Int("m", traceroute.DefaultMaxHops, "maximum TTL probed in traceroute mode")
+	outputMode := flag.String("o", "human", "output format: human, json, prom, or influx")
+	promFile := flag.String("prom-file", "ping.prom", "textfile collector path written to in -o prom mode")
+	flag.Parse()
+
+	rep, err := report.New(*outputMode, os.Stdout, *promFile, *quiet)
+	if err != nil {
+		fmt.Fprint(os.Stderr, colors.FG_RED, err.Error(), "\n", colors.RESET)
+		os.Exit(2)
+	}
+
+	if *ipv4Only && *ipv6Only {
+		fmt.Fprint(os.Stderr, colors.FG_RED, "-4 and -6 are mutually exclusive.\n", colors.RESET)
+		os.Exit(2)
 	}
 
-	fmt.Print(colors.FG_GREEN, "Pinging ", ip.IP.String(), ":\n", colors.RESET)
+	network := "ip"
+	if *ipv4Only {
+		network = "ip4"
+	} else if *ipv6Only {
+		network = "ip6"
+	}
 
-	// Check if IP is IPv4 or v6.
-	if ip.IP.To4() == nil { // Is v6
-		conn, err = icmp.ListenPacket("udp6", "fe80::1%en0")
+	hosts := flag.Args()
+	if len(hosts) > 0 && hosts[0] == "traceroute" {
+		*tracerouteMode = true
+		hosts = hosts[1:]
+	}
 
+	if *hostsFile != "" {
+		fileHosts, err := readHosts(*hostsFile)
 		if err != nil {
-			fmt.Println("ListenPacket IPv6 error: ", err.Error())
+			fmt.Fprint(os.Stderr, colors.FG_RED, err.Error(), "\n", colors.RESET)
+			os.Exit(2)
 		}
+		hosts = append(hosts, fileHosts...)
+	}
 
-		msg = icmp.Message{
-			Type: ipv6.ICMPTypeExtendedEchoRequest,
-			Code: 0, // Code for echo reply.
-			Body: &icmp.Echo{
-				ID:   os.Getpid() & 0xffff,
-				Seq:  1,
-				Data: []byte("PING"),
-			},
-		}
-	} else { // Is v4.
-		conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	// Verify at least one host was provided, exit if one was not.
+	if len(hosts) == 0 {
+		fmt.Fprint(os.Stderr, colors.FG_RED, "PingCLI requires at least one host, either as an argument or via -hosts.\n", colors.RESET)
+		os.Exit(2)
+	}
+
+	if *tracerouteMode {
+		runTraceroute(hosts, network, *maxHops)
+		return
+	}
+
+	p := pinger.New()
+	p.MaxRTT = *perPacketTimeout
+	p.Interval = *interval
+	p.Count = *count
+	p.Deadline = *deadline
+	p.PacketSize = *packetSize
+	p.TTL = *ttl
+
+	statsByHost := make(map[string]*pingStats)
 
+	for _, host := range hosts {
+		ip, err := net.ResolveIPAddr(network, host)
 		if err != nil {
-			fmt.Println("ListenPacket IPv4 error: ", err.Error())
+			fmt.Fprint(os.Stderr, colors.FG_RED, host, ": ", err.Error(), "\n", colors.RESET)
+			continue
 		}
 
-		msg = icmp.Message{
-			Type: ipv4.ICMPTypeEcho,
-			Code: 0, // Code for echo reply.
-			Body: &icmp.Echo{
-				ID:   os.Getpid() & 0xffff,
-				Seq:  1,
-				Data: []byte("PING"),
-			},
+		p.AddIPAddr(ip)
+		statsByHost[ip.String()] = &pingStats{}
+		if !*quiet && *outputMode == "human" {
+			fmt.Print(colors.FG_GREEN, "Pinging ", ip.IP.String(), ":\n", colors.RESET)
 		}
 	}
 
-	message, err := msg.Marshal(nil) // Generate the checksum (if IPv4) and return message binary encoded.
+	if len(statsByHost) == 0 {
+		fmt.Fprint(os.Stderr, colors.FG_RED, "No host could be resolved.\n", colors.RESET)
+		os.Exit(2)
+	}
 
-	if err != nil {
-		panic(err)
+	var mu sync.Mutex
+	var rounds int
+
+	p.OnRecv = func(addr *net.IPAddr, seq, ttl int, rtt time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		rep.Recv(addr.String(), seq, ttl, rtt)
+		if s, ok := statsByHost[addr.String()]; ok {
+			s.Add(rtt)
+		}
+	}
+	p.OnIdle = func() {
+		mu.Lock()
+		rounds++
+		mu.Unlock()
+	}
+	p.OnSendError = func(addr *net.IPAddr, err error) {
+		fmt.Fprint(os.Stderr, colors.FG_RED, addr.String(), ": packet could not be sent: ", err.Error(), "\n", colors.RESET)
 	}
 
 	// Handle the SIGINT to calculate averages and loss percentage.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 
-	// Information received from echo request.
-	receiveChan := make(chan time.Duration)
+	runLoopDone := make(chan struct{})
+	go func() {
+		p.RunLoop()
+		close(runLoopDone)
+	}()
 
-	// Goroutine to ping website.
-	go func(rChan chan time.Duration, c *icmp.PacketConn, ipaddr *net.IPAddr, m []byte) {
-		for {
-			startTime := time.Now() // Get current time.
+	select {
+	case <-sigChan:
+		p.Stop()
+		<-runLoopDone
+	case <-runLoopDone:
+	}
 
-			if _, err := c.WriteTo(m, ipaddr); err != nil { // Send packet.
-				fmt.Println("Packet could not be sent...")
-				fmt.Println(err.Error())
-			}
+	mu.Lock()
+	defer mu.Unlock()
 
-			readBuffer := make([]byte, 1500)    // Create buffer with MTU.
-			_, _, err := c.ReadFrom(readBuffer) // Read from the read buffer.
+	sent := rounds * len(statsByHost)
 
-			// Check if there was an error when reading from connection.
-			if err != nil {
-				fmt.Println("There was an error receiving the packet...")
-			}
+	if p.Err() != nil {
+		fmt.Fprint(os.Stderr, colors.FG_RED, p.Err().Error(), "\n", colors.RESET)
+		os.Exit(2)
+	}
+
+	if sent == 0 {
+		fmt.Fprintln(os.Stderr, "No packets were sent.")
+		os.Exit(2)
+	}
+
+	if *outputMode == "human" {
+		fmt.Print("\n\nReport:")
+		fmt.Print(colors.FG_CYAN, "\nPackets sent:\t\t", sent, "\n", colors.RESET)
+	}
+
+	var totalReceived int64
+
+	for host, s := range statsByHost {
+		totalReceived += s.count
+		rep.Summary(host, int64(rounds), s.count, s.toReportStats())
+	}
 
-			rChan <- time.Since(startTime) // Send the duration.
-			time.Sleep(1 * time.Second)    // Wait for 1 second.
+	if err := rep.Flush(); err != nil {
+		fmt.Fprint(os.Stderr, colors.FG_RED, err.Error(), "\n", colors.RESET)
+		os.Exit(2)
+	}
+
+	// Exit status follows ping(8) convention: 0 on any reply, 1 on total
+	// loss, 2 on error (handled above).
+	if totalReceived == 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runTraceroute traces the route to each host and prints a per-hop
+// report, in lieu of steady-state pinging.
+func runTraceroute(hosts []string, network string, maxHops int) {
+	reached := 0
+
+	for _, host := range hosts {
+		ip, err := net.ResolveIPAddr(network, host)
+		if err != nil {
+			fmt.Fprint(os.Stderr, colors.FG_RED, host, ": ", err.Error(), "\n", colors.RESET)
+			continue
+		}
+
+		fmt.Print(colors.FG_GREEN, "traceroute to ", ip.IP.String(), ", ", maxHops, " hops max:\n", colors.RESET)
+
+		hops, err := traceroute.Run(ip, traceroute.Options{MaxHops: maxHops})
+		if err != nil {
+			fmt.Fprint(os.Stderr, colors.FG_RED, err.Error(), "\n", colors.RESET)
+			continue
 		}
-	}(receiveChan, conn, ip, message)
-
-	// Infinite loop
-	for {
-
-		// Wait for timeout or echo request.
-		select {
-		case <-time.After(TIMEOUT_SECS * time.Second): // Timeout.
-			fmt.Println("Packet timed out...")
-			sent++ // Increase total.
-
-		case <-sigChan: // Catch SIGINT Signal.
-			fmt.Print("\n\nReport:")
-			fmt.Print(colors.FG_CYAN, "\nPackets sent:\t\t", sent, "\n", colors.RESET)
-			fmt.Print(colors.FG_MAGENTA, "Packets received:\t", success, "\n", colors.RESET)
-
-			// Calculate and print packet loss.
-			rate := 100.0 * float32(sent-success) / float32(sent)
-			if rate >= -1.0 && rate <= 33.3 { // Best.
-				fmt.Print(colors.FG_GREEN, "Packet loss:\t\t", rate, "%\n", colors.RESET)
-			} else if rate > 33.3 && rate <= 66.7 { // OK.
-				fmt.Print(colors.FG_YELLOW, "Packet loss: ", rate, "%\n", colors.RESET)
-			} else { // Worst.
-				fmt.Print(colors.FG_RED, "Packet loss: ", rate, "%\n", colors.RESET)
+
+		for _, hop := range hops {
+			if hop.Addr == nil {
+				fmt.Printf("%2d  *\n", hop.TTL)
+				continue
+			}
+
+			rtts := make([]string, len(hop.RTTs))
+			for i, rtt := range hop.RTTs {
+				rtts[i] = rtt.String()
 			}
-			// Print the averate RTT.
-			fmt.Print("Average RTT:\t\t", time.Duration(int64(totalDuration)/int64(sent)), "\n")
-			os.Exit(0)
-
-		case input := <-receiveChan: // Ping is completed and duration is returned.
-			// TODO Logic for measuring packet loss and average RTT.
-			fmt.Println("RTT: ", input)
-			sent++    // Increase total.
-			success++ // Increase successful pings.
-			totalDuration += input
+			fmt.Printf("%2d  %s (%s)  %s\n", hop.TTL, traceroute.Hostname(hop), hop.Addr.String(), strings.Join(rtts, "  "))
+		}
+
+		if len(hops) > 0 && hops[len(hops)-1].Final {
+			reached++
 		}
 	}
 
+	if reached == len(hosts) {
+		os.Exit(0)
+	}
+	os.Exit(1)
 }
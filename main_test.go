@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPingStatsMinMax(t *testing.T) {
+	var s pingStats
+	for _, rtt := range []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond, 20 * time.Millisecond} {
+		s.Add(rtt)
+	}
+
+	if got, want := s.min, 10*time.Millisecond; got != want {
+		t.Errorf("min = %v, want %v", got, want)
+	}
+	if got, want := s.max, 50*time.Millisecond; got != want {
+		t.Errorf("max = %v, want %v", got, want)
+	}
+}
+
+func TestPingStatsAvg(t *testing.T) {
+	var s pingStats
+	for _, rtt := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond} {
+		s.Add(rtt)
+	}
+
+	if got, want := s.Avg(), 20*time.Millisecond; got != want {
+		t.Errorf("Avg() = %v, want %v", got, want)
+	}
+}
+
+func TestPingStatsStddev(t *testing.T) {
+	var s pingStats
+	for _, rtt := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 40 * time.Millisecond} {
+		s.Add(rtt)
+	}
+
+	// Population stddev of {10,20,30,40}ms is sqrt(125)ms.
+	want := time.Duration(math.Sqrt(125) * float64(time.Millisecond))
+	if got := s.Stddev(); got != want {
+		t.Errorf("Stddev() = %v, want %v", got, want)
+	}
+}
+
+func TestPingStatsStddevNeedsTwoSamples(t *testing.T) {
+	var s pingStats
+	if got := s.Stddev(); got != 0 {
+		t.Errorf("Stddev() with no samples = %v, want 0", got)
+	}
+
+	s.Add(10 * time.Millisecond)
+	if got := s.Stddev(); got != 0 {
+		t.Errorf("Stddev() with one sample = %v, want 0", got)
+	}
+}
+
+func TestPingStatsToReportStats(t *testing.T) {
+	var s pingStats
+	s.Add(10 * time.Millisecond)
+	s.Add(20 * time.Millisecond)
+
+	stats := s.toReportStats()
+	if stats.Min != s.min || stats.Max != s.max || stats.Avg != s.Avg() || stats.Stddev != s.Stddev() {
+		t.Errorf("toReportStats() = %+v, does not match accumulator", stats)
+	}
+}
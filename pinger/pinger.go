@@ -0,0 +1,509 @@
+// Package pinger implements a concurrent, multi-host ICMP ping client. A
+// Pinger holds a set of registered targets and fires OnRecv/OnIdle
+// callbacks as replies and idle periods occur, in the style of
+// AnyEvent::FastPing: register targets, wire up callbacks, then Run or
+// RunLoop.
+package pinger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/parkerottaway/PingCLI/icmp6"
+)
+
+const (
+	// DefaultMaxRTT is the MaxRTT a Pinger uses when New'd and never
+	// explicitly configured.
+	DefaultMaxRTT = 5 * time.Second
+
+	// DefaultInterval is the Interval a Pinger uses when New'd and never
+	// explicitly configured.
+	DefaultInterval = 1 * time.Second
+
+	// DefaultPacketSize is the PacketSize a Pinger uses when New'd and
+	// never explicitly configured.
+	DefaultPacketSize = 56
+
+	// minPacketSize is the smallest PacketSize honored, enough to hold
+	// the 8-byte send timestamp every echo request carries.
+	minPacketSize = 8
+)
+
+// pending tracks one in-flight echo request so its reply can be matched
+// back to the target it was sent to; RTT itself is computed from the
+// timestamp the reply echoes back, not from when this entry was made.
+type pending struct {
+	addr *net.IPAddr
+}
+
+// Pinger concurrently pings a set of registered hosts over a single
+// shared icmp.PacketConn per address family.
+type Pinger struct {
+	id int
+
+	mu     sync.Mutex
+	addrs4 map[string]*net.IPAddr
+	addrs6 map[string]*net.IPAddr
+
+	pendMu  sync.Mutex
+	seq     int
+	pending map[int]pending
+
+	conn4 *icmp.PacketConn
+	conn6 *icmp.PacketConn
+
+	// MaxRTT bounds how long a single run waits for outstanding replies
+	// before OnIdle is called. This is the per-packet timeout (ping's
+	// -W).
+	MaxRTT time.Duration
+
+	// Interval is how long RunLoop waits between the end of one run and
+	// the start of the next (ping's -i).
+	Interval time.Duration
+
+	// Count bounds the number of runs RunLoop performs before returning
+	// on its own. Zero means unlimited (ping's -c).
+	Count int
+
+	// Deadline is the wall-clock time after which RunLoop starts no
+	// further runs and returns on its own. Zero means unlimited (ping's
+	// -w). It is checked only before each run: a run in progress and the
+	// Interval wait after it are not cut short, so RunLoop can return up
+	// to one run plus one Interval after Deadline has passed.
+	Deadline time.Duration
+
+	// PacketSize is the number of bytes of data sent in each echo
+	// request, padded out from the 8-byte send timestamp every request
+	// carries (ping's -s). Values below the timestamp size are treated
+	// as that size.
+	PacketSize int
+
+	// TTL sets the outbound IPv4 TTL / IPv6 hop limit on the shared
+	// sockets. Zero leaves the system default in place (ping's -t).
+	TTL int
+
+	// OnRecv is invoked once per reply matched back to a target, with the
+	// sequence number, the reply's IPv4 TTL / IPv6 hop limit, and the RTT
+	// measured from the timestamp encoded in the echo request.
+	OnRecv func(addr *net.IPAddr, seq, ttl int, rtt time.Duration)
+
+	// OnIdle is invoked once a run's MaxRTT has elapsed and no further
+	// replies are expected.
+	OnIdle func()
+
+	// OnSendError is invoked when an echo request could not be written
+	// to addr, so a persistent send failure (unreachable route,
+	// permission error, oversized packet) doesn't just look like
+	// ordinary packet loss with nothing to explain it.
+	OnSendError func(addr *net.IPAddr, err error)
+
+	stop    chan struct{}
+	lastErr error
+}
+
+// New returns a Pinger with no targets registered and MaxRTT, Interval,
+// and PacketSize set to their Default* values.
+func New() *Pinger {
+	return &Pinger{
+		id:         os.Getpid() & 0xffff,
+		addrs4:     make(map[string]*net.IPAddr),
+		addrs6:     make(map[string]*net.IPAddr),
+		pending:    make(map[int]pending),
+		MaxRTT:     DefaultMaxRTT,
+		Interval:   DefaultInterval,
+		PacketSize: DefaultPacketSize,
+	}
+}
+
+// Err returns the error from the most recent Run failure seen inside
+// RunLoop, if any.
+func (p *Pinger) Err() error {
+	return p.lastErr
+}
+
+// AddIPAddr registers ipaddr as a ping target.
+func (p *Pinger) AddIPAddr(ipaddr *net.IPAddr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ipaddr.IP.To4() != nil {
+		p.addrs4[ipaddr.String()] = ipaddr
+	} else {
+		p.addrs6[ipaddr.String()] = ipaddr
+	}
+}
+
+// AddIP resolves host and registers it as a ping target.
+func (p *Pinger) AddIP(host string) error {
+	ipaddr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return err
+	}
+
+	p.AddIPAddr(ipaddr)
+	return nil
+}
+
+// RemoveIPAddr unregisters ipaddr as a ping target.
+func (p *Pinger) RemoveIPAddr(ipaddr *net.IPAddr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if ipaddr.IP.To4() != nil {
+		delete(p.addrs4, ipaddr.String())
+	} else {
+		delete(p.addrs6, ipaddr.String())
+	}
+}
+
+// listen opens the shared ICMP sockets for whichever address families
+// have at least one target registered.
+func (p *Pinger) listen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+
+	if len(p.addrs4) > 0 {
+		if p.conn4, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err != nil {
+			return fmt.Errorf("pinger: listen ipv4: %w", err)
+		}
+	}
+
+	if len(p.addrs6) > 0 {
+		if p.conn6, err = icmp6.Listen(p.anyAddr6()); err != nil {
+			if p.conn4 != nil {
+				p.conn4.Close()
+			}
+			return fmt.Errorf("pinger: listen ipv6: %w", err)
+		}
+	}
+
+	if p.conn4 != nil {
+		if p.TTL > 0 {
+			if err := p.conn4.IPv4PacketConn().SetTTL(p.TTL); err != nil {
+				return fmt.Errorf("pinger: set ipv4 ttl: %w", err)
+			}
+		}
+		// So recvLoop4 can report the TTL a reply actually arrived with.
+		p.conn4.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+	}
+
+	if p.conn6 != nil {
+		if p.TTL > 0 {
+			if err := p.conn6.IPv6PacketConn().SetHopLimit(p.TTL); err != nil {
+				return fmt.Errorf("pinger: set ipv6 hop limit: %w", err)
+			}
+		}
+		p.conn6.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+	}
+
+	return nil
+}
+
+// anyAddr6 returns a registered IPv6 target representative of whichever
+// scope (link-local vs. global/ULA) most of this Pinger's IPv6 targets
+// are in, used to pick a listen address/zone in that same scope.
+//
+// The shared conn6 socket only binds one scope; if both scopes are
+// registered on the same Pinger, targets in the minority scope are left
+// to route however the chosen bind allows, which may not reach them.
+func (p *Pinger) anyAddr6() net.IP {
+	var linkLocal, global net.IP
+	var linkLocalCount, globalCount int
+
+	for _, a := range p.addrs6 {
+		if a.IP.IsLinkLocalUnicast() {
+			linkLocalCount++
+			linkLocal = a.IP
+		} else {
+			globalCount++
+			global = a.IP
+		}
+	}
+
+	if linkLocalCount > globalCount {
+		return linkLocal
+	}
+	return global
+}
+
+// closeConns closes whichever shared sockets are open, unblocking both
+// recvLoop goroutines.
+func (p *Pinger) closeConns() {
+	if p.conn4 != nil {
+		p.conn4.Close()
+	}
+	if p.conn6 != nil {
+		p.conn6.Close()
+	}
+}
+
+// nextSeq returns the next sequence number, used to match a reply back to
+// the pending send that produced it regardless of which target or address
+// family it belongs to. It wraps at 16 bits, the width of the Echo Seq
+// field, so the pending key always equals the Seq a reply carries back.
+func (p *Pinger) nextSeq() int {
+	p.pendMu.Lock()
+	defer p.pendMu.Unlock()
+	p.seq = (p.seq + 1) & 0xffff
+	return p.seq
+}
+
+// sendAll fans out one echo request to every registered target.
+func (p *Pinger) sendAll() {
+	p.mu.Lock()
+	targets4 := make([]*net.IPAddr, 0, len(p.addrs4))
+	for _, a := range p.addrs4 {
+		targets4 = append(targets4, a)
+	}
+	targets6 := make([]*net.IPAddr, 0, len(p.addrs6))
+	for _, a := range p.addrs6 {
+		targets6 = append(targets6, a)
+	}
+	p.mu.Unlock()
+
+	for _, addr := range targets4 {
+		p.send(p.conn4, ipv4.ICMPTypeEcho, addr)
+	}
+	for _, addr := range targets6 {
+		p.send(p.conn6, ipv6.ICMPTypeEchoRequest, addr)
+	}
+}
+
+// send transmits a single echo request to addr over conn, recording it in
+// the pending table so recvLoop can match up its reply.
+func (p *Pinger) send(conn *icmp.PacketConn, t icmp.Type, addr *net.IPAddr) {
+	seq := p.nextSeq()
+
+	size := p.PacketSize
+	if size < minPacketSize {
+		size = minPacketSize
+	}
+
+	sendTime := time.Now()
+	data := make([]byte, size) // Tail beyond the timestamp is left zeroed padding.
+	binary.BigEndian.PutUint64(data, uint64(sendTime.UnixNano()))
+
+	msg := icmp.Message{
+		Type: t,
+		Code: 0, // Code for echo request.
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  seq,
+			Data: data,
+		},
+	}
+
+	message, err := msg.Marshal(nil)
+	if err != nil {
+		return
+	}
+
+	p.pendMu.Lock()
+	p.pending[seq] = pending{addr: addr}
+	p.pendMu.Unlock()
+
+	if _, err := conn.WriteTo(message, addr); err != nil {
+		p.pendMu.Lock()
+		delete(p.pending, seq)
+		p.pendMu.Unlock()
+
+		if p.OnSendError != nil {
+			p.OnSendError(addr, err)
+		}
+	}
+}
+
+// handleReply parses one inbound packet, matches it against the pending
+// table by Echo ID and Seq, and invokes OnRecv.
+func (p *Pinger) handleReply(proto int, b []byte, ttl int) {
+	rm, err := icmp.ParseMessage(proto, b)
+	if err != nil {
+		return
+	}
+
+	echo, ok := rm.Body.(*icmp.Echo)
+	if !ok || echo.ID != p.id {
+		return // Unrelated ICMP traffic on the socket.
+	}
+
+	p.pendMu.Lock()
+	pend, ok := p.pending[echo.Seq]
+	if ok {
+		delete(p.pending, echo.Seq)
+	}
+	p.pendMu.Unlock()
+
+	if !ok {
+		return // Stale or unrecognized reply.
+	}
+
+	if len(echo.Data) < 8 {
+		return // Malformed echo, missing the send timestamp.
+	}
+	sentNanos := int64(binary.BigEndian.Uint64(echo.Data[:8]))
+
+	if p.OnRecv != nil {
+		p.OnRecv(pend.addr, echo.Seq, ttl, time.Since(time.Unix(0, sentNanos)))
+	}
+}
+
+// recvLoop4 reads replies off the IPv4 socket until it is closed,
+// reporting each reply's TTL from its IP control message.
+func (p *Pinger) recvLoop4(conn *icmp.PacketConn, proto int) {
+	pconn := conn.IPv4PacketConn()
+	readBuffer := make([]byte, 1500) // MTU-sized buffer.
+
+	for {
+		n, cm, _, err := pconn.ReadFrom(readBuffer)
+		if err != nil {
+			return // Socket closed.
+		}
+
+		ttl := 0
+		if cm != nil {
+			ttl = cm.TTL
+		}
+
+		p.handleReply(proto, readBuffer[:n], ttl)
+	}
+}
+
+// recvLoop6 reads replies off the IPv6 socket until it is closed,
+// reporting each reply's hop limit from its IP control message.
+func (p *Pinger) recvLoop6(conn *icmp.PacketConn, proto int) {
+	pconn := conn.IPv6PacketConn()
+	readBuffer := make([]byte, 1500) // MTU-sized buffer.
+
+	for {
+		n, cm, _, err := pconn.ReadFrom(readBuffer)
+		if err != nil {
+			return // Socket closed.
+		}
+
+		ttl := 0
+		if cm != nil {
+			ttl = cm.HopLimit
+		}
+
+		p.handleReply(proto, readBuffer[:n], ttl)
+	}
+}
+
+// Run sends one echo request to every registered target, waits up to
+// MaxRTT for replies (invoking OnRecv as they arrive), then invokes
+// OnIdle and returns.
+func (p *Pinger) Run() error {
+	if err := p.listen(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+
+	if p.conn4 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.recvLoop4(p.conn4, ipv4.ICMPTypeEchoReply.Protocol())
+		}()
+	}
+	if p.conn6 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.recvLoop6(p.conn6, ipv6.ICMPTypeEchoReply.Protocol())
+		}()
+	}
+
+	var sendWG sync.WaitGroup
+	sendWG.Add(1)
+	go func() {
+		defer sendWG.Done()
+		p.sendAll()
+	}()
+
+	// Targets are only deferred to the next round once every send this
+	// round has actually been attempted; otherwise a slow sendAll still
+	// in flight when MaxRTT elapses would have its remaining WriteTo
+	// calls hit an already-closed socket.
+	sendWG.Wait()
+
+	time.Sleep(p.MaxRTT)
+	p.closeConns()
+	wg.Wait()
+
+	// Anything still in the pending table got no reply this run, and
+	// with the sockets now closed none ever will arrive for it. Sweep it
+	// so a long-running RunLoop against a lossy host doesn't grow this
+	// table for the life of the process.
+	p.clearPending()
+
+	if p.OnIdle != nil {
+		p.OnIdle()
+	}
+
+	return nil
+}
+
+// clearPending drops every still-unmatched send recorded during the run
+// that just ended.
+func (p *Pinger) clearPending() {
+	p.pendMu.Lock()
+	defer p.pendMu.Unlock()
+	p.pending = make(map[int]pending)
+}
+
+// RunLoop calls Run repeatedly, waiting Interval between runs, until Stop
+// is called, Count runs have completed, Deadline has elapsed, or a Run
+// fails. The failing Run's error (if any) is available afterward via Err.
+func (p *Pinger) RunLoop() {
+	p.stop = make(chan struct{})
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	var deadlineAt time.Time
+	if p.Deadline > 0 {
+		deadlineAt = time.Now().Add(p.Deadline)
+	}
+
+	for runs := 0; p.Count <= 0 || runs < p.Count; runs++ {
+		if !deadlineAt.IsZero() && time.Now().After(deadlineAt) {
+			return
+		}
+
+		if err := p.Run(); err != nil {
+			p.lastErr = err
+			return
+		}
+
+		if p.Count > 0 && runs+1 >= p.Count {
+			return
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Stop ends a RunLoop started on this Pinger.
+func (p *Pinger) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+	}
+}
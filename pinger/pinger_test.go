@@ -0,0 +1,111 @@
+package pinger
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// echoReplyBytes marshals a minimal IPv4 echo reply carrying sentNanos as
+// its 8-byte send timestamp, the same shape send() produces.
+func echoReplyBytes(t *testing.T, id, seq int, sentNanos int64) []byte {
+	t.Helper()
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(sentNanos))
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEchoReply,
+		Code: 0,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: data},
+	}
+
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return b
+}
+
+func TestHandleReplyMatchesPendingBySeq(t *testing.T) {
+	p := New()
+	addr := &net.IPAddr{IP: net.ParseIP("192.0.2.1")}
+	p.pending[7] = pending{addr: addr}
+
+	sendTime := time.Now().Add(-10 * time.Millisecond)
+	b := echoReplyBytes(t, p.id, 7, sendTime.UnixNano())
+
+	var gotAddr *net.IPAddr
+	var gotSeq, gotTTL int
+	var gotRTT time.Duration
+	p.OnRecv = func(a *net.IPAddr, seq, ttl int, rtt time.Duration) {
+		gotAddr, gotSeq, gotTTL, gotRTT = a, seq, ttl, rtt
+	}
+
+	p.handleReply(ipv4.ICMPTypeEchoReply.Protocol(), b, 64)
+
+	if gotAddr != addr {
+		t.Errorf("OnRecv addr = %v, want %v", gotAddr, addr)
+	}
+	if gotSeq != 7 {
+		t.Errorf("OnRecv seq = %d, want 7", gotSeq)
+	}
+	if gotTTL != 64 {
+		t.Errorf("OnRecv ttl = %d, want 64", gotTTL)
+	}
+	if gotRTT <= 0 {
+		t.Errorf("OnRecv rtt = %v, want > 0", gotRTT)
+	}
+
+	if _, stillPending := p.pending[7]; stillPending {
+		t.Error("pending[7] still present after a matched reply")
+	}
+}
+
+func TestHandleReplyIgnoresUnknownSeq(t *testing.T) {
+	p := New()
+
+	called := false
+	p.OnRecv = func(addr *net.IPAddr, seq, ttl int, rtt time.Duration) { called = true }
+
+	b := echoReplyBytes(t, p.id, 99, time.Now().UnixNano())
+	p.handleReply(ipv4.ICMPTypeEchoReply.Protocol(), b, 64)
+
+	if called {
+		t.Error("OnRecv called for a seq with no pending entry")
+	}
+}
+
+func TestHandleReplyIgnoresForeignID(t *testing.T) {
+	p := New()
+	p.pending[1] = pending{addr: &net.IPAddr{IP: net.ParseIP("192.0.2.1")}}
+
+	called := false
+	p.OnRecv = func(addr *net.IPAddr, seq, ttl int, rtt time.Duration) { called = true }
+
+	b := echoReplyBytes(t, p.id+1, 1, time.Now().UnixNano())
+	p.handleReply(ipv4.ICMPTypeEchoReply.Protocol(), b, 64)
+
+	if called {
+		t.Error("OnRecv called for a reply with a foreign ICMP ID")
+	}
+	if _, stillPending := p.pending[1]; !stillPending {
+		t.Error("pending[1] removed by a reply that didn't match its ID")
+	}
+}
+
+func TestClearPendingSweepsEntries(t *testing.T) {
+	p := New()
+	p.pending[1] = pending{addr: &net.IPAddr{IP: net.ParseIP("192.0.2.1")}}
+	p.pending[2] = pending{addr: &net.IPAddr{IP: net.ParseIP("192.0.2.2")}}
+
+	p.clearPending()
+
+	if len(p.pending) != 0 {
+		t.Errorf("len(pending) = %d after clearPending, want 0", len(p.pending))
+	}
+}
@@ -0,0 +1,254 @@
+// Package report renders ping activity in a pluggable output format, so
+// PingCLI can feed monitoring pipelines (node_exporter's textfile
+// collector, Telegraf's exec input) as easily as it prints to a
+// terminal.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/parkerottaway/PingCLI/colors"
+)
+
+// Stats is the subset of running RTT statistics a Reporter needs to
+// render a summary line.
+type Stats struct {
+	Min, Avg, Max, Stddev time.Duration
+}
+
+// Reporter renders ping results in a particular output format: one call
+// to Recv per reply as it arrives, one call to Summary per host once
+// pinging for that host stops, then a single Flush once every summary
+// has been emitted.
+type Reporter interface {
+	// Recv is called once per reply.
+	Recv(target string, seq, ttl int, rtt time.Duration)
+
+	// Summary is called once per host after pinging finishes.
+	Summary(target string, sent, received int64, stats Stats)
+
+	// Flush gives batching reporters (e.g. prom) a chance to write out
+	// accumulated state. Reporters that render as they go are a no-op.
+	Flush() error
+}
+
+// New returns the Reporter for the named output mode: "human" (the
+// default), "json", "prom", or "influx". w is where human/json/influx
+// write their output; promFile names the textfile collector path "prom"
+// mode writes to on Flush. quiet suppresses humanReporter's per-packet
+// line; it has no effect on the other modes: json still writes one
+// object per reply, prom's Recv only records the latest RTT, and
+// influx's Recv does nothing.
+func New(mode string, w io.Writer, promFile string, quiet bool) (Reporter, error) {
+	switch mode {
+	case "", "human":
+		return &humanReporter{w: w, quiet: quiet}, nil
+	case "json":
+		return &jsonReporter{enc: json.NewEncoder(w)}, nil
+	case "prom":
+		return newPromReporter(promFile), nil
+	case "influx":
+		return &influxReporter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("report: unknown output mode %q", mode)
+	}
+}
+
+// lossRatio returns the fraction of sent packets that went unanswered.
+func lossRatio(sent, received int64) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return float64(sent-received) / float64(sent)
+}
+
+// humanReporter is the original colorized, human-readable output.
+type humanReporter struct {
+	w     io.Writer
+	quiet bool // Suppresses Recv's per-packet line; Summary always prints.
+}
+
+func (r *humanReporter) Recv(target string, seq, ttl int, rtt time.Duration) {
+	if r.quiet {
+		return
+	}
+	fmt.Fprint(r.w, colors.FG_CYAN, target, colors.RESET, " RTT: ", rtt, "\n")
+}
+
+func (r *humanReporter) Summary(target string, sent, received int64, stats Stats) {
+	fmt.Fprint(r.w, colors.FG_MAGENTA, "\n", target, colors.RESET, "\n")
+
+	if received == 0 {
+		fmt.Fprintln(r.w, "No replies received.")
+		return
+	}
+
+	rate := 100 * lossRatio(sent, received)
+	switch {
+	case rate <= 33.3: // Best.
+		fmt.Fprint(r.w, colors.FG_GREEN, "Packet loss:\t\t", rate, "%\n", colors.RESET)
+	case rate <= 66.7: // OK.
+		fmt.Fprint(r.w, colors.FG_YELLOW, "Packet loss: ", rate, "%\n", colors.RESET)
+	default: // Worst.
+		fmt.Fprint(r.w, colors.FG_RED, "Packet loss: ", rate, "%\n", colors.RESET)
+	}
+
+	fmt.Fprint(r.w, "RTT min/avg/max/stddev:\t", stats.Min, " / ", stats.Avg, " / ", stats.Max, " / ", stats.Stddev, "\n")
+}
+
+func (r *humanReporter) Flush() error { return nil }
+
+// jsonReporter emits one NDJSON object per reply, then one per host
+// summary, so PingCLI's output can be piped straight into log processors.
+type jsonReporter struct {
+	enc *json.Encoder
+}
+
+type jsonReply struct {
+	Target string `json:"target"`
+	Seq    int    `json:"seq"`
+	RTTNs  int64  `json:"rtt_ns"`
+	TTL    int    `json:"ttl"`
+	TS     int64  `json:"ts"`
+}
+
+type jsonSummary struct {
+	Target      string  `json:"target"`
+	Sent        int64   `json:"sent"`
+	Received    int64   `json:"received"`
+	LossRatio   float64 `json:"loss_ratio"`
+	MinRTTNs    int64   `json:"min_rtt_ns"`
+	AvgRTTNs    int64   `json:"avg_rtt_ns"`
+	MaxRTTNs    int64   `json:"max_rtt_ns"`
+	StddevRTTNs int64   `json:"stddev_rtt_ns"`
+}
+
+func (r *jsonReporter) Recv(target string, seq, ttl int, rtt time.Duration) {
+	r.enc.Encode(jsonReply{Target: target, Seq: seq, RTTNs: int64(rtt), TTL: ttl, TS: time.Now().UnixNano()})
+}
+
+func (r *jsonReporter) Summary(target string, sent, received int64, stats Stats) {
+	r.enc.Encode(jsonSummary{
+		Target:      target,
+		Sent:        sent,
+		Received:    received,
+		LossRatio:   lossRatio(sent, received),
+		MinRTTNs:    int64(stats.Min),
+		AvgRTTNs:    int64(stats.Avg),
+		MaxRTTNs:    int64(stats.Max),
+		StddevRTTNs: int64(stats.Stddev),
+	})
+}
+
+func (r *jsonReporter) Flush() error { return nil }
+
+// promReporter accumulates the latest RTT and loss figures per target
+// and writes them out as a Prometheus textfile collector exposition on
+// Flush.
+type promReporter struct {
+	path string
+
+	mu   sync.Mutex
+	rtt  map[string]time.Duration
+	sent map[string]int64
+	recv map[string]int64
+	loss map[string]float64
+}
+
+func newPromReporter(path string) *promReporter {
+	return &promReporter{
+		path: path,
+		rtt:  make(map[string]time.Duration),
+		sent: make(map[string]int64),
+		recv: make(map[string]int64),
+		loss: make(map[string]float64),
+	}
+}
+
+func (r *promReporter) Recv(target string, seq, ttl int, rtt time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rtt[target] = rtt
+}
+
+func (r *promReporter) Summary(target string, sent, received int64, stats Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent[target] = sent
+	r.recv[target] = received
+	r.loss[target] = lossRatio(sent, received)
+}
+
+func (r *promReporter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+
+	fmt.Fprintln(&buf, "# HELP ping_rtt_seconds Round-trip time of the most recent reply.")
+	fmt.Fprintln(&buf, "# TYPE ping_rtt_seconds gauge")
+	for target, rtt := range r.rtt {
+		fmt.Fprintf(&buf, "ping_rtt_seconds{target=%q} %f\n", target, rtt.Seconds())
+	}
+
+	fmt.Fprintln(&buf, "# HELP ping_packets_sent_total Total echo requests sent.")
+	fmt.Fprintln(&buf, "# TYPE ping_packets_sent_total counter")
+	for target, sent := range r.sent {
+		fmt.Fprintf(&buf, "ping_packets_sent_total{target=%q} %d\n", target, sent)
+	}
+
+	fmt.Fprintln(&buf, "# HELP ping_packets_received_total Total echo replies received.")
+	fmt.Fprintln(&buf, "# TYPE ping_packets_received_total counter")
+	for target, recv := range r.recv {
+		fmt.Fprintf(&buf, "ping_packets_received_total{target=%q} %d\n", target, recv)
+	}
+
+	fmt.Fprintln(&buf, "# HELP ping_packet_loss_ratio Fraction of echo requests that went unanswered.")
+	fmt.Fprintln(&buf, "# TYPE ping_packet_loss_ratio gauge")
+	for target, loss := range r.loss {
+		fmt.Fprintf(&buf, "ping_packet_loss_ratio{target=%q} %f\n", target, loss)
+	}
+
+	// Write then rename so the textfile collector never reads a partial file.
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("report: write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// influxReporter emits one InfluxDB line-protocol point per host
+// summary on Flush.
+type influxReporter struct {
+	w io.Writer
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *influxReporter) Recv(target string, seq, ttl int, rtt time.Duration) {}
+
+func (r *influxReporter) Summary(target string, sent, received int64, stats Stats) {
+	line := fmt.Sprintf("ping,target=%s rtt=%f,loss=%f,sent=%di,recv=%di %d",
+		target, stats.Avg.Seconds(), lossRatio(sent, received), sent, received, time.Now().UnixNano())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+}
+
+func (r *influxReporter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, line := range r.lines {
+		fmt.Fprintln(r.w, line)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHumanReporterRecv(t *testing.T) {
+	var buf bytes.Buffer
+	r := &humanReporter{w: &buf}
+
+	r.Recv("192.0.2.1", 1, 64, 10*time.Millisecond)
+
+	if got := buf.String(); !strings.Contains(got, "192.0.2.1") || !strings.Contains(got, "10ms") {
+		t.Errorf("Recv() output = %q, want it to mention the target and RTT", got)
+	}
+}
+
+func TestHumanReporterRecvQuietSuppressed(t *testing.T) {
+	var buf bytes.Buffer
+	r := &humanReporter{w: &buf, quiet: true}
+
+	r.Recv("192.0.2.1", 1, 64, 10*time.Millisecond)
+
+	if got := buf.String(); got != "" {
+		t.Errorf("Recv() output = %q, want empty when quiet", got)
+	}
+}
+
+func TestHumanReporterSummaryNotSuppressedByQuiet(t *testing.T) {
+	var buf bytes.Buffer
+	r := &humanReporter{w: &buf, quiet: true}
+
+	r.Summary("192.0.2.1", 10, 8, Stats{Min: time.Millisecond, Avg: 2 * time.Millisecond, Max: 3 * time.Millisecond})
+
+	if got := buf.String(); !strings.Contains(got, "192.0.2.1") {
+		t.Errorf("Summary() output = %q, want it to still print under quiet", got)
+	}
+}
+
+func TestJSONReporterRecv(t *testing.T) {
+	var buf bytes.Buffer
+	r := &jsonReporter{enc: json.NewEncoder(&buf)}
+
+	r.Recv("192.0.2.1", 3, 64, 25*time.Millisecond)
+
+	var got jsonReply
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Target != "192.0.2.1" || got.Seq != 3 || got.TTL != 64 || got.RTTNs != int64(25*time.Millisecond) {
+		t.Errorf("Recv() = %+v, want target=192.0.2.1 seq=3 ttl=64 rtt_ns=%d", got, int64(25*time.Millisecond))
+	}
+}
+
+func TestJSONReporterSummary(t *testing.T) {
+	var buf bytes.Buffer
+	r := &jsonReporter{enc: json.NewEncoder(&buf)}
+
+	r.Summary("192.0.2.1", 10, 5, Stats{Min: time.Millisecond, Avg: 2 * time.Millisecond, Max: 3 * time.Millisecond, Stddev: time.Millisecond})
+
+	var got jsonSummary
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Sent != 10 || got.Received != 5 || got.LossRatio != 0.5 {
+		t.Errorf("Summary() = %+v, want sent=10 received=5 loss_ratio=0.5", got)
+	}
+}
+
+func TestPromReporterRecvAndFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ping.prom")
+	r := newPromReporter(path)
+
+	r.Recv("192.0.2.1", 1, 64, 15*time.Millisecond)
+	r.Summary("192.0.2.1", 10, 8, Stats{})
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`ping_rtt_seconds{target="192.0.2.1"} 0.015000`,
+		`ping_packets_sent_total{target="192.0.2.1"} 10`,
+		`ping_packets_received_total{target="192.0.2.1"} 8`,
+		`ping_packet_loss_ratio{target="192.0.2.1"} 0.200000`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Flush() output missing %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestPromReporterRecvWithoutSummaryStillFlushesRTT(t *testing.T) {
+	// This is what -q -o prom must keep doing: Recv populates the gauge
+	// Flush emits even when no human-readable printing ever happens.
+	path := filepath.Join(t.TempDir(), "ping.prom")
+	r := newPromReporter(path)
+
+	r.Recv("192.0.2.1", 1, 64, 30*time.Millisecond)
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want := `ping_rtt_seconds{target="192.0.2.1"} 0.030000`; !strings.Contains(string(out), want) {
+		t.Errorf("Flush() output missing %q, got:\n%s", want, out)
+	}
+}
+
+func TestInfluxReporterSummary(t *testing.T) {
+	var buf bytes.Buffer
+	r := &influxReporter{w: &buf}
+
+	r.Summary("192.0.2.1", 10, 5, Stats{Avg: 20 * time.Millisecond})
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "ping,target=192.0.2.1 ") {
+		t.Errorf("Flush() output = %q, want a line-protocol point for 192.0.2.1", got)
+	}
+	if !strings.Contains(got, "sent=10i") || !strings.Contains(got, "recv=5i") {
+		t.Errorf("Flush() output = %q, want sent=10i and recv=5i fields", got)
+	}
+}
+
+func TestInfluxReporterRecvIsNoop(t *testing.T) {
+	var buf bytes.Buffer
+	r := &influxReporter{w: &buf}
+
+	r.Recv("192.0.2.1", 1, 64, 10*time.Millisecond)
+
+	if got := buf.String(); got != "" {
+		t.Errorf("Recv() output = %q, want no output (influx only reports summaries)", got)
+	}
+}
@@ -0,0 +1,220 @@
+// Package traceroute implements a minimal ICMP traceroute: probe the
+// destination with successively larger TTLs, reading TimeExceeded
+// replies from the routers in between until the destination itself
+// answers with an EchoReply.
+package traceroute
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/parkerottaway/PingCLI/icmp6"
+)
+
+const (
+	// DefaultMaxHops is the maximum TTL probed when Options.MaxHops is
+	// left unset.
+	DefaultMaxHops = 30
+
+	// DefaultProbesPerHop is the number of probes sent per TTL when
+	// Options.ProbesPerHop is left unset.
+	DefaultProbesPerHop = 3
+
+	// DefaultTimeout is how long a single probe waits for its reply when
+	// Options.Timeout is left unset.
+	DefaultTimeout = 1 * time.Second
+
+	ipv6HeaderLen = 40 // Fixed IPv6 header; extension headers are not handled.
+)
+
+// Hop is one row of a traceroute report.
+type Hop struct {
+	TTL   int
+	Addr  net.Addr        // Nil if every probe at this TTL timed out.
+	RTTs  []time.Duration // One entry per probe that got a reply.
+	Final bool            // True once Addr is the destination itself.
+}
+
+// Options configures a Run.
+type Options struct {
+	MaxHops      int
+	ProbesPerHop int
+	Timeout      time.Duration
+}
+
+// Run traces the route to dest, probing TTLs 1..MaxHops until dest
+// replies or MaxHops is reached.
+func Run(dest *net.IPAddr, opts Options) ([]Hop, error) {
+	if opts.MaxHops <= 0 {
+		opts.MaxHops = DefaultMaxHops
+	}
+	if opts.ProbesPerHop <= 0 {
+		opts.ProbesPerHop = DefaultProbesPerHop
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	isV4 := dest.IP.To4() != nil
+	id := os.Getpid() & 0xffff
+
+	var conn *icmp.PacketConn
+	var err error
+	var echoType icmp.Type
+
+	if isV4 {
+		conn, err = icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+		echoType = ipv4.ICMPTypeEcho
+	} else {
+		conn, err = icmp6.Listen(dest.IP)
+		echoType = ipv6.ICMPTypeEchoRequest
+	}
+	if err != nil {
+		return nil, fmt.Errorf("traceroute: listen: %w", err)
+	}
+	defer conn.Close()
+
+	proto := echoType.Protocol()
+
+	var hops []Hop
+
+	for ttl := 1; ttl <= opts.MaxHops; ttl++ {
+		if isV4 {
+			if err := conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+				return hops, fmt.Errorf("traceroute: set ipv4 ttl: %w", err)
+			}
+		} else {
+			if err := conn.IPv6PacketConn().SetHopLimit(ttl); err != nil {
+				return hops, fmt.Errorf("traceroute: set ipv6 hop limit: %w", err)
+			}
+		}
+
+		hop := Hop{TTL: ttl}
+		seq := ttl // One TTL is fully probed before the next begins, so Seq alone disambiguates replies.
+
+		for probe := 0; probe < opts.ProbesPerHop; probe++ {
+			msg := icmp.Message{
+				Type: echoType,
+				Code: 0,
+				Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, 8)},
+			}
+
+			message, err := msg.Marshal(nil)
+			if err != nil {
+				return hops, err
+			}
+
+			sendTime := time.Now()
+			if _, err := conn.WriteTo(message, dest); err != nil {
+				continue
+			}
+
+			conn.SetReadDeadline(sendTime.Add(opts.Timeout))
+			addr, final, ok := readHopReply(conn, proto, id, seq, isV4)
+			if !ok {
+				continue
+			}
+
+			hop.RTTs = append(hop.RTTs, time.Since(sendTime))
+			if hop.Addr == nil {
+				hop.Addr = addr
+			}
+			if final {
+				hop.Final = true
+			}
+		}
+
+		hops = append(hops, hop)
+		if hop.Final {
+			break
+		}
+	}
+
+	return hops, nil
+}
+
+// readHopReply reads packets off conn until it sees a reply matching id
+// and seq, or the read deadline set by the caller expires. It reports
+// the replying address and whether that reply was the final EchoReply
+// from the destination itself, as opposed to an intermediate
+// TimeExceeded.
+func readHopReply(conn *icmp.PacketConn, proto, id, seq int, isV4 bool) (addr net.Addr, final, ok bool) {
+	buf := make([]byte, 1500)
+
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, false, false // Deadline exceeded.
+		}
+
+		rm, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := rm.Body.(type) {
+		case *icmp.TimeExceeded:
+			gotID, gotSeq, ok := embeddedEcho(isV4, body.Data)
+			if !ok || gotID != id || gotSeq != seq {
+				continue
+			}
+			return peer, false, true
+
+		case *icmp.Echo:
+			if body.ID != id || body.Seq != seq {
+				continue
+			}
+			return peer, true, true
+
+		default:
+			continue
+		}
+	}
+}
+
+// embeddedEcho extracts the ID and Seq of the original echo request
+// carried inside a TimeExceeded error's payload: the inner IP header,
+// followed by the first 8 bytes of the original datagram (the ICMP echo
+// header itself).
+func embeddedEcho(isV4 bool, payload []byte) (id, seq int, ok bool) {
+	ipHeaderLen := ipv6HeaderLen
+	if isV4 {
+		if len(payload) < 1 {
+			return 0, 0, false
+		}
+		ipHeaderLen = int(payload[0]&0x0f) * 4
+	}
+
+	if len(payload) < ipHeaderLen+8 {
+		return 0, 0, false
+	}
+
+	inner := payload[ipHeaderLen : ipHeaderLen+8]
+	return int(binary.BigEndian.Uint16(inner[4:6])), int(binary.BigEndian.Uint16(inner[6:8])), true
+}
+
+// Hostname reverse-resolves hop's responding address, falling back to
+// its plain IP string when no PTR record is found.
+func Hostname(hop Hop) string {
+	if hop.Addr == nil {
+		return "*"
+	}
+
+	host := hop.Addr.String()
+	if udpAddr, ok := hop.Addr.(*net.UDPAddr); ok {
+		host = udpAddr.IP.String() // A udp6 socket's peer prints as "[ip]:0".
+	}
+
+	names, err := net.LookupAddr(host)
+	if err != nil || len(names) == 0 {
+		return host
+	}
+	return names[0]
+}
@@ -0,0 +1,79 @@
+package traceroute
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// ipv4Header builds a minimal IPv4 header of the given length in bytes
+// (a multiple of 4), with only the IHL nibble set.
+func ipv4Header(length int) []byte {
+	h := make([]byte, length)
+	h[0] = byte(length/4) & 0x0f
+	return h
+}
+
+func echoHeader(id, seq int) []byte {
+	h := make([]byte, 8)
+	binary.BigEndian.PutUint16(h[4:6], uint16(id))
+	binary.BigEndian.PutUint16(h[6:8], uint16(seq))
+	return h
+}
+
+func TestEmbeddedEchoIPv4(t *testing.T) {
+	payload := append(ipv4Header(20), echoHeader(1234, 7)...)
+
+	id, seq, ok := embeddedEcho(true, payload)
+	if !ok {
+		t.Fatal("embeddedEcho() ok = false, want true")
+	}
+	if id != 1234 || seq != 7 {
+		t.Errorf("embeddedEcho() = (%d, %d), want (1234, 7)", id, seq)
+	}
+}
+
+func TestEmbeddedEchoIPv4WithOptions(t *testing.T) {
+	// IHL of 6 means a 24-byte header (20 fixed + 4 bytes of options).
+	payload := append(ipv4Header(24), echoHeader(99, 3)...)
+
+	id, seq, ok := embeddedEcho(true, payload)
+	if !ok {
+		t.Fatal("embeddedEcho() ok = false, want true")
+	}
+	if id != 99 || seq != 3 {
+		t.Errorf("embeddedEcho() = (%d, %d), want (99, 3)", id, seq)
+	}
+}
+
+func TestEmbeddedEchoIPv6(t *testing.T) {
+	payload := append(make([]byte, ipv6HeaderLen), echoHeader(42, 9)...)
+
+	id, seq, ok := embeddedEcho(false, payload)
+	if !ok {
+		t.Fatal("embeddedEcho() ok = false, want true")
+	}
+	if id != 42 || seq != 9 {
+		t.Errorf("embeddedEcho() = (%d, %d), want (42, 9)", id, seq)
+	}
+}
+
+func TestEmbeddedEchoTruncated(t *testing.T) {
+	cases := []struct {
+		name    string
+		isV4    bool
+		payload []byte
+	}{
+		{"empty", true, nil},
+		{"ipv4 header only", true, ipv4Header(20)},
+		{"ipv6 header only", false, make([]byte, ipv6HeaderLen)},
+		{"ipv6 short of full echo header", false, make([]byte, ipv6HeaderLen+4)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, _, ok := embeddedEcho(c.isV4, c.payload); ok {
+				t.Error("embeddedEcho() ok = true, want false")
+			}
+		})
+	}
+}